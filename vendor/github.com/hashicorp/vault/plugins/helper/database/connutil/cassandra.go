@@ -2,6 +2,7 @@ package connutil
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/gocql/gocql"
 	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/tlsutil"
 )
 
@@ -25,17 +27,39 @@ type CassandraConnectionProducer struct {
 	Certificate     string `json:"certificate" structs:"certificate" mapstructure:"certificate"`
 	PrivateKey      string `json:"private_key" structs:"private_key" mapstructure:"private_key"`
 	IssuingCA       string `json:"issuing_ca" structs:"issuing_ca" mapstructure:"issuing_ca"`
+	PEMBundle       string `json:"pem_bundle" structs:"pem_bundle" mapstructure:"pem_bundle"`
+	PEMJSON         string `json:"pem_json" structs:"pem_json" mapstructure:"pem_json"`
 	ProtocolVersion int    `json:"protocol_version" structs:"protocol_version" mapstructure:"protocol_version"`
 	ConnectTimeout  int    `json:"connect_timeout" structs:"connect_timeout" mapstructure:"connect_timeout"`
 	TLSMinVersion   string `json:"tls_min_version" structs:"tls_min_version" mapstructure:"tls_min_version"`
+	TLSServerName   string `json:"tls_server_name" structs:"tls_server_name" mapstructure:"tls_server_name"`
 	Consistency     string `json:"consistency" structs:"consistency" mapstructure:"consistency"`
 
+	ConnectionVerifyQuery string `json:"connection_verify_query" structs:"connection_verify_query" mapstructure:"connection_verify_query"`
+
+	SocketKeepAlive          interface{} `json:"socket_keep_alive" structs:"socket_keep_alive" mapstructure:"socket_keep_alive"`
+	NumConns                 int         `json:"num_conns" structs:"num_conns" mapstructure:"num_conns"`
+	Timeout                  interface{} `json:"timeout" structs:"timeout" mapstructure:"timeout"`
+	DisableInitialHostLookup bool        `json:"disable_initial_host_lookup" structs:"disable_initial_host_lookup" mapstructure:"disable_initial_host_lookup"`
+	LocalDatacenter          string      `json:"local_datacenter" structs:"local_datacenter" mapstructure:"local_datacenter"`
+	NumRetries               int         `json:"num_retries" structs:"num_retries" mapstructure:"num_retries"`
+
+	socketKeepAlive time.Duration
+	timeout         time.Duration
+	verifyOnConnect bool
+
 	Initialized bool
 	Type        string
 	session     *gocql.Session
 	sync.Mutex
 }
 
+// defaultConnectionVerifyQuery is used to confirm connectivity when
+// ConnectionVerifyQuery is not set. Unlike `LIST USERS`, it requires no
+// elevated privileges and is understood by Cassandra-compatible services
+// such as ScyllaDB and Astra.
+const defaultConnectionVerifyQuery = `SELECT release_version FROM system.local`
+
 func (c *CassandraConnectionProducer) Initialize(conf map[string]interface{}, verifyConnection bool) error {
 	c.Lock()
 	defer c.Unlock()
@@ -44,6 +68,22 @@ func (c *CassandraConnectionProducer) Initialize(conf map[string]interface{}, ve
 	if err != nil {
 		return err
 	}
+
+	if c.SocketKeepAlive != nil {
+		c.socketKeepAlive, err = parseutil.ParseDurationSecond(c.SocketKeepAlive)
+		if err != nil {
+			return fmt.Errorf("invalid 'socket_keep_alive' value: %s", err)
+		}
+	}
+
+	if c.Timeout != nil {
+		c.timeout, err = parseutil.ParseDurationSecond(c.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid 'timeout' value: %s", err)
+		}
+	}
+
+	c.verifyOnConnect = verifyConnection
 	c.Initialized = true
 
 	if verifyConnection {
@@ -69,12 +109,36 @@ func (c *CassandraConnectionProducer) Connection() (interface{}, error) {
 		return nil, err
 	}
 
+	if c.verifyOnConnect {
+		if err := c.verifyConnection(session); err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+
 	//  Store the session in backend for reuse
 	c.session = session
 
 	return session, nil
 }
 
+// verifyConnection confirms that session can reach the cluster and run a
+// query as the configured user. It is only invoked when Initialize is
+// called with verifyConnection=true, so operators can configure
+// low-privilege service accounts that aren't granted whatever permissions
+// ConnectionVerifyQuery would otherwise require.
+func (c *CassandraConnectionProducer) verifyConnection(session *gocql.Session) error {
+	query := c.ConnectionVerifyQuery
+	if query == "" {
+		query = defaultConnectionVerifyQuery
+	}
+
+	if err := session.Query(query).Exec(); err != nil {
+		return fmt.Errorf("error validating connection info: %s", err)
+	}
+	return nil
+}
+
 func (c *CassandraConnectionProducer) Close() error {
 	// Grab the write lock
 	c.Lock()
@@ -89,7 +153,87 @@ func (c *CassandraConnectionProducer) Close() error {
 	return nil
 }
 
+// tlsConfig builds the *tls.Config used to dial Cassandra. It supports three
+// independent shapes of trust material: a CA-only trust anchor, a client
+// cert/key pair with no custom CA (trusting the system roots), or full
+// mutual TLS. 'pem_bundle' and 'pem_json' are higher-level alternatives to
+// setting 'certificate', 'private_key', and 'issuing_ca' individually and
+// are mutually exclusive with them.
+func (c *CassandraConnectionProducer) tlsConfig() (*tls.Config, error) {
+	switch {
+	case c.PEMBundle != "" && c.PEMJSON != "":
+		return nil, fmt.Errorf("cannot use both 'pem_bundle' and 'pem_json'")
+
+	case c.PEMBundle != "":
+		if c.Certificate != "" || c.PrivateKey != "" || c.IssuingCA != "" {
+			return nil, fmt.Errorf("cannot use 'pem_bundle' alongside 'certificate', 'private_key', or 'issuing_ca'")
+		}
+
+		parsedCertBundle, err := certutil.ParsePEMBundle(c.PEMBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse 'pem_bundle': %s", err)
+		}
+
+		tlsConfig, err := parsedCertBundle.GetTLSConfig(certutil.TLSClient)
+		if err != nil || tlsConfig == nil {
+			return nil, fmt.Errorf("failed to get TLS configuration: tlsConfig:%#v err:%v", tlsConfig, err)
+		}
+		return tlsConfig, nil
+
+	case c.PEMJSON != "":
+		if c.Certificate != "" || c.PrivateKey != "" || c.IssuingCA != "" {
+			return nil, fmt.Errorf("cannot use 'pem_json' alongside 'certificate', 'private_key', or 'issuing_ca'")
+		}
+
+		certBundle := &certutil.CertBundle{}
+		if err := json.Unmarshal([]byte(c.PEMJSON), certBundle); err != nil {
+			return nil, fmt.Errorf("failed to parse 'pem_json': %s", err)
+		}
+		return certBundleTLSConfig(certBundle)
+
+	case c.Certificate != "" || c.PrivateKey != "" || c.IssuingCA != "":
+		if c.Certificate != "" && c.PrivateKey == "" {
+			return nil, fmt.Errorf("certificate provided without matching private key")
+		}
+		if c.PrivateKey != "" && c.Certificate == "" {
+			return nil, fmt.Errorf("private key provided without matching certificate")
+		}
+
+		certBundle := &certutil.CertBundle{}
+		if c.Certificate != "" {
+			certBundle.Certificate = c.Certificate
+			certBundle.PrivateKey = c.PrivateKey
+		}
+		if c.IssuingCA != "" {
+			certBundle.IssuingCA = c.IssuingCA
+		}
+		return certBundleTLSConfig(certBundle)
+
+	default:
+		// No client cert and no custom CA: use the system trust store with
+		// no client authentication.
+		return &tls.Config{}, nil
+	}
+}
+
+func certBundleTLSConfig(certBundle *certutil.CertBundle) (*tls.Config, error) {
+	parsedCertBundle, err := certBundle.ToParsedCertBundle()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate bundle: %s", err)
+	}
+
+	tlsConfig, err := parsedCertBundle.GetTLSConfig(certutil.TLSClient)
+	if err != nil || tlsConfig == nil {
+		return nil, fmt.Errorf("failed to get TLS configuration: tlsConfig:%#v err:%v", tlsConfig, err)
+	}
+	return tlsConfig, nil
+}
+
 func (c *CassandraConnectionProducer) createSession() (*gocql.Session, error) {
+	if c.TLSServerName != "" && !c.TLS {
+		return nil, fmt.Errorf("'tls_server_name' was set but 'tls' is false")
+	}
+
 	clusterConfig := gocql.NewCluster(strings.Split(c.Hosts, ",")...)
 	clusterConfig.Authenticator = gocql.PasswordAuthenticator{
 		Username: c.Username,
@@ -102,45 +246,64 @@ func (c *CassandraConnectionProducer) createSession() (*gocql.Session, error) {
 	}
 
 	clusterConfig.Timeout = time.Duration(c.ConnectTimeout) * time.Second
+	clusterConfig.ConnectTimeout = time.Duration(c.ConnectTimeout) * time.Second
+	if c.timeout != 0 {
+		clusterConfig.Timeout = c.timeout
+	}
+
+	if c.socketKeepAlive != 0 {
+		clusterConfig.SocketKeepalive = c.socketKeepAlive
+	}
+
+	if c.NumConns > 0 {
+		clusterConfig.NumConns = c.NumConns
+	}
+
+	clusterConfig.DisableInitialHostLookup = c.DisableInitialHostLookup
+
+	if c.LocalDatacenter != "" {
+		clusterConfig.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(
+			gocql.DCAwareRoundRobinPolicy(c.LocalDatacenter),
+		)
+	}
+
+	// Reconnect with a bounded exponential backoff instead of gocql's
+	// unbounded default so a flapping node can't pin a session into a tight
+	// reconnect loop.
+	clusterConfig.ReconnectionPolicy = &gocql.ExponentialReconnectionPolicy{
+		MaxRetries:      10,
+		InitialInterval: time.Second,
+		MaxInterval:     10 * time.Second,
+	}
+
+	if c.NumRetries > 0 {
+		clusterConfig.RetryPolicy = &gocql.SimpleRetryPolicy{
+			NumRetries: c.NumRetries,
+		}
+	}
 
 	if c.TLS {
-		var tlsConfig *tls.Config
-		if len(c.Certificate) > 0 || len(c.IssuingCA) > 0 {
-			if len(c.Certificate) > 0 && len(c.PrivateKey) == 0 {
-				return nil, fmt.Errorf("found certificate for TLS authentication but no private key")
-			}
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
 
-			certBundle := &certutil.CertBundle{}
-			if len(c.Certificate) > 0 {
-				certBundle.Certificate = c.Certificate
-				certBundle.PrivateKey = c.PrivateKey
-			}
-			if len(c.IssuingCA) > 0 {
-				certBundle.IssuingCA = c.IssuingCA
-			}
+		tlsConfig.InsecureSkipVerify = c.InsecureTLS
 
-			parsedCertBundle, err := certBundle.ToParsedCertBundle()
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse certificate bundle: %s", err)
-			}
+		if c.TLSServerName != "" {
+			tlsConfig.ServerName = c.TLSServerName
+		}
 
-			tlsConfig, err = parsedCertBundle.GetTLSConfig(certutil.TLSClient)
-			if err != nil || tlsConfig == nil {
-				return nil, fmt.Errorf("failed to get TLS configuration: tlsConfig:%#v err:%v", tlsConfig, err)
-			}
-			tlsConfig.InsecureSkipVerify = c.InsecureTLS
-
-			if c.TLSMinVersion != "" {
-				var ok bool
-				tlsConfig.MinVersion, ok = tlsutil.TLSLookup[c.TLSMinVersion]
-				if !ok {
-					return nil, fmt.Errorf("invalid 'tls_min_version' in config")
-				}
-			} else {
-				// MinVersion was not being set earlier. Reset it to
-				// zero to gracefully handle upgrades.
-				tlsConfig.MinVersion = 0
+		if c.TLSMinVersion != "" {
+			var ok bool
+			tlsConfig.MinVersion, ok = tlsutil.TLSLookup[c.TLSMinVersion]
+			if !ok {
+				return nil, fmt.Errorf("invalid 'tls_min_version' in config")
 			}
+		} else {
+			// MinVersion was not being set earlier. Reset it to
+			// zero to gracefully handle upgrades.
+			tlsConfig.MinVersion = 0
 		}
 
 		clusterConfig.SslOpts = &gocql.SslOptions{
@@ -163,11 +326,5 @@ func (c *CassandraConnectionProducer) createSession() (*gocql.Session, error) {
 		session.SetConsistency(consistencyValue)
 	}
 
-	// Verify the info
-	err = session.Query(`LIST USERS`).Exec()
-	if err != nil {
-		return nil, fmt.Errorf("error validating connection info: %s", err)
-	}
-
 	return session, nil
 }